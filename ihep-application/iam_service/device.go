@@ -0,0 +1,141 @@
+// iam_service/device.go
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// knownDeviceThreshold is how many sightings of a fingerprint, counting the
+// current one, are required before it's treated as a fully trusted device.
+const knownDeviceThreshold = 3
+
+// DeviceRecord tracks how many times a fingerprint has been seen for a user,
+// so the device factor can distinguish a brand new device from one the user
+// has authenticated from repeatedly.
+type DeviceRecord struct {
+    Fingerprint string    `json:"fingerprint"`
+    UserID      string    `json:"user_id"`
+    SeenCount   int       `json:"seen_count"`
+    FirstSeen   time.Time `json:"first_seen"`
+    LastSeen    time.Time `json:"last_seen"`
+    Revoked     bool      `json:"revoked"`
+}
+
+// DeviceStore persists DeviceRecords, keyed on the fingerprint derived from
+// DeviceID/UserAgent/AcceptLanguage, so SeenCount survives process restarts
+// and is visible to every instance behind the load balancer; the in-memory
+// implementation below only satisfies the single-process case.
+type DeviceStore interface {
+    Get(fingerprint string) (*DeviceRecord, bool, error)
+    RecordSighting(fingerprint, userID string) (*DeviceRecord, error)
+    Revoke(fingerprint string) error
+}
+
+type InMemoryDeviceStore struct {
+    mu      sync.Mutex
+    records map[string]*DeviceRecord
+}
+
+func NewInMemoryDeviceStore() *InMemoryDeviceStore {
+    return &InMemoryDeviceStore{
+        records: make(map[string]*DeviceRecord),
+    }
+}
+
+func (s *InMemoryDeviceStore) Get(fingerprint string) (*DeviceRecord, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    record, ok := s.records[fingerprint]
+    return record, ok, nil
+}
+
+func (s *InMemoryDeviceStore) RecordSighting(fingerprint, userID string) (*DeviceRecord, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now().UTC()
+    record, ok := s.records[fingerprint]
+    if !ok {
+        record = &DeviceRecord{
+            Fingerprint: fingerprint,
+            UserID:      userID,
+            FirstSeen:   now,
+        }
+        s.records[fingerprint] = record
+    }
+
+    record.SeenCount++
+    record.LastSeen = now
+    return record, nil
+}
+
+func (s *InMemoryDeviceStore) Revoke(fingerprint string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    record, ok := s.records[fingerprint]
+    if !ok {
+        return fmt.Errorf("device %s not found", fingerprint)
+    }
+    record.Revoked = true
+    return nil
+}
+
+// DeviceRegistry computes stable fingerprints and scores how trusted the
+// resulting device is, backed by a DeviceStore.
+type DeviceRegistry struct {
+    store DeviceStore
+    salt  string
+}
+
+func NewDeviceRegistry(store DeviceStore, salt string) *DeviceRegistry {
+    return &DeviceRegistry{store: store, salt: salt}
+}
+
+// Fingerprint derives a stable per-user device identity from the device ID,
+// user agent, and accept-language header, salted so fingerprints can't be
+// correlated across users.
+func (r *DeviceRegistry) Fingerprint(userID, deviceID, userAgent, acceptLanguage string) string {
+    h := sha256.New()
+    h.Write([]byte(userID))
+    h.Write([]byte("|"))
+    h.Write([]byte(deviceID))
+    h.Write([]byte("|"))
+    h.Write([]byte(userAgent))
+    h.Write([]byte("|"))
+    h.Write([]byte(acceptLanguage))
+    h.Write([]byte("|"))
+    h.Write([]byte(r.salt))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// Score records this sighting and returns φ₂, the device trust factor:
+// revoked devices score 0, devices seen at least knownDeviceThreshold times
+// score 1.0, and everything else scores 0.2 as a cautious default for an
+// unfamiliar device.
+func (r *DeviceRegistry) Score(userID, deviceID, userAgent, acceptLanguage string) (float64, error) {
+    fingerprint := r.Fingerprint(userID, deviceID, userAgent, acceptLanguage)
+
+    existing, found, err := r.store.Get(fingerprint)
+    if err != nil {
+        return 0, fmt.Errorf("failed to look up device: %v", err)
+    }
+    if found && existing.Revoked {
+        return 0.0, nil
+    }
+
+    record, err := r.store.RecordSighting(fingerprint, userID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to record device sighting: %v", err)
+    }
+
+    if record.SeenCount >= knownDeviceThreshold {
+        return 1.0, nil
+    }
+    return 0.2, nil
+}
@@ -0,0 +1,141 @@
+// iam_service/geolocation.go
+package main
+
+import (
+    "fmt"
+    "math"
+    "net"
+
+    "github.com/oschwald/geoip2-golang"
+)
+
+// impossibleTravelSpeedKMH is the threshold above which two logins can't
+// plausibly be the same person, per the spec's "≥900 km/h" rule.
+const impossibleTravelSpeedKMH = 900.0
+
+const earthRadiusKM = 6371.0
+
+// GeoPoint is a resolved location for a login, along with the
+// human-readable country/city GeoIP returned it for.
+type GeoPoint struct {
+    Lat     float64
+    Lon     float64
+    Country string
+    City    string
+}
+
+// GeoLocator resolves an IP address to a location. The default
+// implementation here is a stand-in for a MaxMind GeoIP2 (or equivalent)
+// lookup.
+type GeoLocator interface {
+    Locate(ipAddress string) (GeoPoint, error)
+}
+
+// StaticGeoLocator is a dev-only GeoLocator for environments without a
+// GeoIP database wired up; it returns the same point for every IP, which
+// collapses locationFactor to a constant 1.0 for every login. main.go
+// refuses to boot with this locator when IAM_ENVIRONMENT=production, so it
+// can only reach a real deployment by misconfiguration, not by default.
+type StaticGeoLocator struct {
+    Default GeoPoint
+}
+
+func NewStaticGeoLocator() *StaticGeoLocator {
+    return &StaticGeoLocator{
+        Default: GeoPoint{Lat: 37.7749, Lon: -122.4194, Country: "US", City: "San Francisco"},
+    }
+}
+
+func (g *StaticGeoLocator) Locate(ipAddress string) (GeoPoint, error) {
+    return g.Default, nil
+}
+
+// MaxMindGeoLocator resolves IPs against a local MaxMind GeoIP2/GeoLite2
+// City database. This is the GeoLocator real deployments use; without it,
+// every login resolves to the same StaticGeoLocator point and the location
+// factor never reflects where a request actually came from.
+type MaxMindGeoLocator struct {
+    db *geoip2.Reader
+}
+
+// NewMaxMindGeoLocator opens the MaxMind database at path. The returned
+// locator holds the database mmap'd for the life of the process; call
+// Close on shutdown to release it.
+func NewMaxMindGeoLocator(path string) (*MaxMindGeoLocator, error) {
+    db, err := geoip2.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open GeoIP database %s: %v", path, err)
+    }
+    return &MaxMindGeoLocator{db: db}, nil
+}
+
+func (g *MaxMindGeoLocator) Close() error {
+    return g.db.Close()
+}
+
+func (g *MaxMindGeoLocator) Locate(ipAddress string) (GeoPoint, error) {
+    ip := net.ParseIP(ipAddress)
+    if ip == nil {
+        return GeoPoint{}, fmt.Errorf("invalid IP address %q", ipAddress)
+    }
+
+    record, err := g.db.City(ip)
+    if err != nil {
+        return GeoPoint{}, fmt.Errorf("GeoIP lookup failed for %s: %v", ipAddress, err)
+    }
+
+    return GeoPoint{
+        Lat:     record.Location.Latitude,
+        Lon:     record.Location.Longitude,
+        Country: record.Country.IsoCode,
+        City:    record.City.Names["en"],
+    }, nil
+}
+
+// haversineKM returns the great-circle distance between two points in
+// kilometers.
+func haversineKM(a, b GeoPoint) float64 {
+    lat1, lon1 := degToRad(a.Lat), degToRad(a.Lon)
+    lat2, lon2 := degToRad(b.Lat), degToRad(b.Lon)
+
+    dLat := lat2 - lat1
+    dLon := lon2 - lon1
+
+    h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+        math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+    c := 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+
+    return earthRadiusKM * c
+}
+
+func degToRad(deg float64) float64 {
+    return deg * math.Pi / 180
+}
+
+// locationFactor scores φ₃ by comparing the current login's location to the
+// centroid of the user's recent logins: same country/city scores 1.0,
+// impossible travel (faster than impossibleTravelSpeedKMH) scores 0.0, and
+// everything in between decays linearly with implied travel speed.
+func locationFactor(current GeoPoint, centroid GeoPoint, sinceLastLogin float64) float64 {
+    if current.Country == centroid.Country && current.City == centroid.City {
+        return 1.0
+    }
+
+    distance := haversineKM(current, centroid)
+    if sinceLastLogin <= 0 {
+        if distance == 0 {
+            return 1.0
+        }
+        return 0.0
+    }
+
+    speed := distance / sinceLastLogin
+    if speed >= impossibleTravelSpeedKMH {
+        return 0.0
+    }
+
+    if current.Country == centroid.Country {
+        return 0.7 * (1 - speed/impossibleTravelSpeedKMH)
+    }
+    return 0.5 * (1 - speed/impossibleTravelSpeedKMH)
+}
@@ -0,0 +1,47 @@
+// iam_service/geolocation_test.go
+package main
+
+import "testing"
+
+func TestLocationFactorSameLocationScoresFull(t *testing.T) {
+    sf := GeoPoint{Lat: 37.7749, Lon: -122.4194, Country: "US", City: "San Francisco"}
+
+    got := locationFactor(sf, sf, 24)
+    if got != 1.0 {
+        t.Fatalf("locationFactor(sf, sf, 24) = %v, want 1.0", got)
+    }
+}
+
+func TestLocationFactorImpossibleTravelScoresZero(t *testing.T) {
+    sf := GeoPoint{Lat: 37.7749, Lon: -122.4194, Country: "US", City: "San Francisco"}
+    nyc := GeoPoint{Lat: 40.7128, Lon: -74.0060, Country: "US", City: "New York"}
+
+    got := locationFactor(nyc, sf, 0.1) // ~4100km in 6 minutes
+    if got != 0.0 {
+        t.Fatalf("locationFactor(nyc, sf, 0.1) = %v, want 0.0", got)
+    }
+}
+
+func TestCentroidLabelsMostRecentCountryCity(t *testing.T) {
+    profile := &UserProfile{
+        RecentLogins: []GeoPoint{
+            {Lat: 37.7749, Lon: -122.4194, Country: "US", City: "San Francisco"},
+            {Lat: 37.7750, Lon: -122.4195, Country: "US", City: "San Francisco"},
+        },
+    }
+
+    got := profile.centroid()
+    if got.Country != "US" || got.City != "San Francisco" {
+        t.Fatalf("centroid() country/city = %q/%q, want US/San Francisco", got.Country, got.City)
+    }
+}
+
+func TestRepeatedLoginFromSameLocationScoresFull(t *testing.T) {
+    sf := GeoPoint{Lat: 37.7749, Lon: -122.4194, Country: "US", City: "San Francisco"}
+    profile := &UserProfile{RecentLogins: []GeoPoint{sf}}
+
+    got := locationFactor(sf, profile.centroid(), 24)
+    if got != 1.0 {
+        t.Fatalf("locationFactor on repeat login from same point = %v, want 1.0", got)
+    }
+}
@@ -7,8 +7,10 @@ import (
     "encoding/json"
     "fmt"
     "log"
+    "net"
     "net/http"
     "os"
+    "strings"
     "time"
 
     "github.com/golang-jwt/jwt/v4"
@@ -34,10 +36,18 @@ type TrustFactors struct {
 }
 
 type AuthRequest struct {
-    Email    string `json:"email"`
-    Password string `json:"password"`
-    MFACode  string `json:"mfa_code"`
-    DeviceID string `json:"device_id"`
+    Email     string    `json:"email"`
+    Password  string    `json:"password"`
+    MFACode   string    `json:"mfa_code"`
+    MFAMethod MFAMethod `json:"mfa_method"`
+    DeviceID  string    `json:"device_id"`
+
+    // Populated by loginHandler from the request, not the JSON body, so
+    // the trust evaluator has what it needs to compute the device and
+    // location factors.
+    UserAgent      string `json:"-"`
+    AcceptLanguage string `json:"-"`
+    IPAddress      string `json:"-"`
 }
 
 type AuthResponse struct {
@@ -54,12 +64,46 @@ type Claims struct {
 
 type IAMService struct {
     jwtSecret []byte
+    evaluator TrustEvaluator
 }
 
-func NewIAMService() *IAMService {
+// newGeoLocator builds the GeoLocator the trust evaluator scores φ₃
+// against. GEOIP_DB_PATH, when set, points at a MaxMind GeoIP2/GeoLite2 City
+// database and is used for real lookups. Without it, IAM_ENVIRONMENT=production
+// refuses to boot rather than silently scoring every login's location as
+// trusted; anywhere else, it falls back to StaticGeoLocator so the rest of
+// the pipeline can still be exercised without a database on hand.
+func newGeoLocator() (GeoLocator, error) {
+    if dbPath := os.Getenv("GEOIP_DB_PATH"); dbPath != "" {
+        locator, err := NewMaxMindGeoLocator(dbPath)
+        if err != nil {
+            return nil, err
+        }
+        return locator, nil
+    }
+
+    if os.Getenv("IAM_ENVIRONMENT") == "production" {
+        return nil, fmt.Errorf("GEOIP_DB_PATH must be set in production; refusing to boot with the static GeoLocator stub")
+    }
+
+    log.Printf("warning: GEOIP_DB_PATH is not set; falling back to StaticGeoLocator, which resolves every IP to the same point")
+    return NewStaticGeoLocator(), nil
+}
+
+func NewIAMService() (*IAMService, error) {
+    deviceRegistry := NewDeviceRegistry(NewInMemoryDeviceStore(), os.Getenv("DEVICE_FINGERPRINT_SALT"))
+
+    geoLocator, err := newGeoLocator()
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize GeoLocator: %v", err)
+    }
+
+    evaluator := NewDefaultTrustEvaluator(deviceRegistry, geoLocator, NewInMemoryUserProfileStore())
+
     return &IAMService{
         jwtSecret: []byte(os.Getenv("JWT_SECRET_KEY")),
-    }
+        evaluator: evaluator,
+    }, nil
 }
 
 func (s *IAMService) calculateTrustScore(factors TrustFactors) float64 {
@@ -93,28 +137,38 @@ func (s *IAMService) authenticateUser(req AuthRequest) (*AuthResponse, error) {
     }
 
     // Verify MFA (simplified)
-    mfaValid := verifyMFA(req.Email, req.MFACode)
+    mfaValid := verifyMFA(req.Email, req.MFACode, req.MFAMethod)
     if !mfaValid {
         return nil, fmt.Errorf("invalid MFA code")
     }
 
-    // Calculate trust factors
-    factors := TrustFactors{
-        MFA:      0.95, // Simplified - would be dynamic in real implementation
-        Device:   0.90,
-        Location: 0.85,
-        Behavior: 0.80,
-        Time:     0.75,
+    factors, err := s.evaluator.Evaluate(context.Background(), user, req, req.MFAMethod)
+    if err != nil {
+        return nil, fmt.Errorf("failed to evaluate trust factors: %v", err)
     }
 
     trustScore := s.calculateTrustScore(factors)
-    
+
     // Require minimum trust score
     if trustScore < 0.75 {
         return nil, fmt.Errorf("insufficient trust score: %.2f", trustScore)
     }
 
-    // Generate JWT token
+    tokenString, expirationTime, err := s.issueToken(user, trustScore)
+    if err != nil {
+        return nil, err
+    }
+
+    return &AuthResponse{
+        Token:      tokenString,
+        TrustScore: trustScore,
+        ExpiresAt:  expirationTime.Unix(),
+    }, nil
+}
+
+// issueToken signs a JWT carrying the user's identity and trust score. It's
+// shared by the login and step-up flows so both mint tokens the same way.
+func (s *IAMService) issueToken(user *User, trustScore float64) (string, time.Time, error) {
     expirationTime := time.Now().Add(15 * time.Minute)
     claims := &Claims{
         UserID:     user.ID,
@@ -129,14 +183,10 @@ func (s *IAMService) authenticateUser(req AuthRequest) (*AuthResponse, error) {
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     tokenString, err := token.SignedString(s.jwtSecret)
     if err != nil {
-        return nil, fmt.Errorf("could not generate token: %v", err)
+        return "", time.Time{}, fmt.Errorf("could not generate token: %v", err)
     }
 
-    return &AuthResponse{
-        Token:      tokenString,
-        TrustScore: trustScore,
-        ExpiresAt:  expirationTime.Unix(),
-    }, nil
+    return tokenString, expirationTime, nil
 }
 
 func (s *IAMService) loginHandler(w http.ResponseWriter, r *http.Request) {
@@ -146,6 +196,10 @@ func (s *IAMService) loginHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    req.UserAgent = r.UserAgent()
+    req.AcceptLanguage = r.Header.Get("Accept-Language")
+    req.IPAddress = clientIP(r)
+
     response, err := s.authenticateUser(req)
     if err != nil {
         log.Printf("Authentication failed for %s: %v", req.Email, err)
@@ -186,11 +240,15 @@ func (s *IAMService) validateTokenHandler(w http.ResponseWriter, r *http.Request
 }
 
 func main() {
-    service := NewIAMService()
-    
+    service, err := NewIAMService()
+    if err != nil {
+        log.Fatalf("failed to initialize IAM service: %v", err)
+    }
+
     r := mux.NewRouter()
     r.HandleFunc("/v1/auth/login", service.loginHandler).Methods("POST")
     r.HandleFunc("/v1/auth/validate", service.validateTokenHandler).Methods("GET")
+    r.HandleFunc("/v1/auth/step-up", service.stepUpHandler).Methods("POST")
     r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusOK)
         json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
@@ -218,7 +276,24 @@ func getUserByEmail(email string) (*User, error) {
     }, nil
 }
 
-func verifyMFA(email, code string) bool {
+func verifyMFA(email, code string, method MFAMethod) bool {
     // This would verify against an MFA service
+    if method == MFANone {
+        return code == ""
+    }
     return code == "123456" // Simplified for example
 }
+
+// clientIP extracts the caller's IP for GeoIP lookups, preferring
+// X-Forwarded-For (set by the load balancer) and falling back to the
+// connection's remote address.
+func clientIP(r *http.Request) string {
+    if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+        return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
@@ -0,0 +1,200 @@
+// iam_service/profile.go
+package main
+
+import (
+    "math"
+    "sync"
+    "time"
+)
+
+// recentLoginWindow is K, the number of recent logins the rolling location
+// centroid is computed over.
+const recentLoginWindow = 10
+
+// ewmaAlpha controls how quickly the behavior EWMAs adapt to new samples;
+// lower values weight history more heavily.
+const ewmaAlpha = 0.2
+
+// UserProfile is the per-user state the behavior, time, and location
+// factors are scored against. It's updated after every login.
+type UserProfile struct {
+    UserID string
+
+    RecentLogins []GeoPoint // ring buffer, most recent last, capped at recentLoginWindow
+    LastLogin    GeoPoint
+    LastLoginAt  time.Time
+
+    EWMAHour    float64 // mean hour-of-day (0-23) of past logins
+    EWMAHourVar float64
+
+    EWMAIntervalSeconds    float64 // mean seconds between logins
+    EWMAIntervalSecondsVar float64
+
+    HourHistogram [24]int
+    LoginCount    int
+}
+
+// centroid returns the mean lat/lon of the user's recent logins, labeled
+// with the most recent login's country/city so locationFactor's
+// same-country/city fast path has something to compare against.
+func (p *UserProfile) centroid() GeoPoint {
+    if len(p.RecentLogins) == 0 {
+        return p.LastLogin
+    }
+
+    var sumLat, sumLon float64
+    for _, pt := range p.RecentLogins {
+        sumLat += pt.Lat
+        sumLon += pt.Lon
+    }
+    n := float64(len(p.RecentLogins))
+    last := p.RecentLogins[len(p.RecentLogins)-1]
+    return GeoPoint{Lat: sumLat / n, Lon: sumLon / n, Country: last.Country, City: last.City}
+}
+
+// UserProfileStore persists UserProfiles between logins. The behavior, time,
+// and location factors all need the prior profile to score against, so this
+// has to survive past the request that wrote it; InMemoryUserProfileStore
+// only does that for the lifetime of one process.
+type UserProfileStore interface {
+    Get(userID string) (*UserProfile, bool, error)
+    RecordLogin(userID string, point GeoPoint, at time.Time) (*UserProfile, error)
+}
+
+type InMemoryUserProfileStore struct {
+    mu       sync.Mutex
+    profiles map[string]*UserProfile
+}
+
+func NewInMemoryUserProfileStore() *InMemoryUserProfileStore {
+    return &InMemoryUserProfileStore{
+        profiles: make(map[string]*UserProfile),
+    }
+}
+
+func (s *InMemoryUserProfileStore) Get(userID string) (*UserProfile, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    profile, ok := s.profiles[userID]
+    if !ok {
+        return nil, false, nil
+    }
+
+    // Return a copy so the caller can score against pre-update state even
+    // after RecordLogin mutates the stored profile.
+    snapshot := *profile
+    snapshot.RecentLogins = append([]GeoPoint(nil), profile.RecentLogins...)
+    return &snapshot, true, nil
+}
+
+func (s *InMemoryUserProfileStore) RecordLogin(userID string, point GeoPoint, at time.Time) (*UserProfile, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    profile, ok := s.profiles[userID]
+    if !ok {
+        profile = &UserProfile{UserID: userID}
+        s.profiles[userID] = profile
+    }
+
+    hour := float64(at.UTC().Hour())
+    if profile.LoginCount == 0 {
+        profile.EWMAHour = hour
+    } else {
+        delta := circularHourDelta(hour, profile.EWMAHour)
+        profile.EWMAHour = math.Mod(profile.EWMAHour+ewmaAlpha*delta+24, 24)
+        profile.EWMAHourVar = (1 - ewmaAlpha) * (profile.EWMAHourVar + ewmaAlpha*delta*delta)
+    }
+
+    if !profile.LastLoginAt.IsZero() {
+        interval := at.Sub(profile.LastLoginAt).Seconds()
+        if profile.LoginCount == 1 {
+            profile.EWMAIntervalSeconds = interval
+        } else {
+            delta := interval - profile.EWMAIntervalSeconds
+            profile.EWMAIntervalSeconds += ewmaAlpha * delta
+            profile.EWMAIntervalSecondsVar = (1 - ewmaAlpha) * (profile.EWMAIntervalSecondsVar + ewmaAlpha*delta*delta)
+        }
+    }
+
+    profile.HourHistogram[int(hour)]++
+    profile.LoginCount++
+    profile.LastLogin = point
+    profile.LastLoginAt = at
+
+    profile.RecentLogins = append(profile.RecentLogins, point)
+    if len(profile.RecentLogins) > recentLoginWindow {
+        profile.RecentLogins = profile.RecentLogins[len(profile.RecentLogins)-recentLoginWindow:]
+    }
+
+    return profile, nil
+}
+
+// circularHourDelta is the signed distance between two hours-of-day on a
+// 24-hour clock, e.g. the gap between hour 23 and hour 1 is 2, not 22.
+func circularHourDelta(hour, mean float64) float64 {
+    diff := hour - mean
+    for diff > 12 {
+        diff -= 24
+    }
+    for diff < -12 {
+        diff += 24
+    }
+    return diff
+}
+
+// behaviorFactor scores φ₄ from how anomalous the current login hour and
+// inter-login interval are relative to the user's EWMA baseline: a z-score
+// near zero (typical timing) scores close to 1, a large z-score (unusual
+// timing) decays toward 0 via a sigmoid.
+func behaviorFactor(profile *UserProfile, loginAt time.Time) float64 {
+    if profile == nil || profile.LoginCount == 0 {
+        return 0.5 // no history yet; neutral default
+    }
+
+    hourZ := zScore(circularHourDelta(float64(loginAt.UTC().Hour()), profile.EWMAHour), profile.EWMAHourVar)
+
+    var intervalZ float64
+    if !profile.LastLoginAt.IsZero() && profile.LoginCount > 1 {
+        interval := loginAt.Sub(profile.LastLoginAt).Seconds()
+        intervalZ = zScore(interval-profile.EWMAIntervalSeconds, profile.EWMAIntervalSecondsVar)
+    }
+
+    z := (math.Abs(hourZ) + math.Abs(intervalZ)) / 2
+    return sigmoid(2.0 - z)
+}
+
+// timeFactor scores φ₅ by comparing the current hour to the user's
+// historical activity histogram: the hour the user logs in most often
+// scores 1.0, hours they've never logged in at score close to 0.
+func timeFactor(profile *UserProfile, loginAt time.Time) float64 {
+    if profile == nil || profile.LoginCount == 0 {
+        return 0.5 // no history yet; neutral default
+    }
+
+    max := 0
+    for _, count := range profile.HourHistogram {
+        if count > max {
+            max = count
+        }
+    }
+    if max == 0 {
+        return 0.5
+    }
+
+    hour := loginAt.UTC().Hour()
+    return float64(profile.HourHistogram[hour]) / float64(max)
+}
+
+func zScore(delta, variance float64) float64 {
+    stddev := math.Sqrt(variance)
+    if stddev < 1e-6 {
+        stddev = 1e-6
+    }
+    return delta / stddev
+}
+
+func sigmoid(x float64) float64 {
+    return 1.0 / (1.0 + math.Exp(-x))
+}
@@ -0,0 +1,96 @@
+// iam_service/stepup.go
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+
+    "github.com/golang-jwt/jwt/v4"
+)
+
+// StepUpRequest is presented after a downstream service rejects a call for
+// insufficient trust: the caller completes an additional challenge and
+// trades their existing token for one with a higher trust score.
+type StepUpRequest struct {
+    MFACode   string    `json:"mfa_code"`
+    MFAMethod MFAMethod `json:"mfa_method"`
+    DeviceID  string    `json:"device_id"`
+}
+
+// stepUpHandler reissues the caller's token after they satisfy a stronger
+// MFA challenge, recomputing trust with that higher-assurance factor.
+func (s *IAMService) stepUpHandler(w http.ResponseWriter, r *http.Request) {
+    tokenString := r.Header.Get("Authorization")
+    if tokenString == "" {
+        http.Error(w, "Authorization header required", http.StatusUnauthorized)
+        return
+    }
+
+    claims := &Claims{}
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        return s.jwtSecret, nil
+    })
+    if err != nil || !token.Valid {
+        http.Error(w, "Invalid token", http.StatusUnauthorized)
+        return
+    }
+
+    var req StepUpRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if !verifyMFA(claims.Subject, req.MFACode, req.MFAMethod) {
+        http.Error(w, "invalid MFA code", http.StatusUnauthorized)
+        return
+    }
+
+    user, err := getUserByEmail(claims.Subject)
+    if err != nil {
+        http.Error(w, "invalid credentials", http.StatusUnauthorized)
+        return
+    }
+
+    authReq := AuthRequest{
+        Email:          claims.Subject,
+        DeviceID:       req.DeviceID,
+        MFAMethod:      req.MFAMethod,
+        UserAgent:      r.UserAgent(),
+        AcceptLanguage: r.Header.Get("Accept-Language"),
+        IPAddress:      clientIP(r),
+    }
+
+    factors, err := s.evaluator.Evaluate(context.Background(), user, authReq, req.MFAMethod)
+    if err != nil {
+        log.Printf("failed to evaluate step-up trust factors for %s: %v", claims.Subject, err)
+        http.Error(w, "Failed to evaluate trust", http.StatusInternalServerError)
+        return
+    }
+
+    trustScore := s.calculateTrustScore(factors)
+    if trustScore < 0.75 {
+        http.Error(w, fmt.Sprintf("insufficient trust score: %.2f", trustScore), http.StatusUnauthorized)
+        return
+    }
+    if trustScore <= claims.TrustScore {
+        http.Error(w, fmt.Sprintf("step-up did not raise trust score: %.2f", trustScore), http.StatusUnauthorized)
+        return
+    }
+
+    tokenStr, expirationTime, err := s.issueToken(user, trustScore)
+    if err != nil {
+        http.Error(w, "could not generate token", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(AuthResponse{
+        Token:      tokenStr,
+        TrustScore: trustScore,
+        ExpiresAt:  expirationTime.Unix(),
+    })
+}
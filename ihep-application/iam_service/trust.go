@@ -0,0 +1,103 @@
+// iam_service/trust.go
+package main
+
+import (
+    "context"
+    "time"
+)
+
+// MFAMethod identifies which second factor the caller actually presented,
+// so the MFA trust factor reflects its real assurance level instead of a
+// constant.
+type MFAMethod string
+
+const (
+    MFANone     MFAMethod = "none"
+    MFASMSOTP   MFAMethod = "sms_otp"
+    MFATOTP     MFAMethod = "totp"
+    MFAWebAuthn MFAMethod = "webauthn"
+)
+
+// mfaFactor maps the MFA method used into φ₁. TOTP and WebAuthn are
+// possession+cryptographic proofs so they score full trust; SMS OTP is
+// phishable/SIM-swappable so it's scored lower; no MFA scores zero.
+func mfaFactor(method MFAMethod) float64 {
+    switch method {
+    case MFATOTP, MFAWebAuthn:
+        return 1.0
+    case MFASMSOTP:
+        return 0.7
+    default:
+        return 0.0
+    }
+}
+
+// TrustEvaluator computes the per-request TrustFactors that feed
+// calculateTrustScore's T(u,r,t) formula. It's an interface so the whole
+// evaluator can be swapped; the individual factor computers are plain
+// functions that DefaultTrustEvaluator calls directly and that can be
+// unit-tested on their own.
+type TrustEvaluator interface {
+    Evaluate(ctx context.Context, user *User, req AuthRequest, mfaMethod MFAMethod) (TrustFactors, error)
+}
+
+// DefaultTrustEvaluator wires the device, location, behavior, and time
+// factor computers together against their persisted state.
+type DefaultTrustEvaluator struct {
+    devices      *DeviceRegistry
+    geo          GeoLocator
+    profileStore UserProfileStore
+}
+
+func NewDefaultTrustEvaluator(devices *DeviceRegistry, geo GeoLocator, profileStore UserProfileStore) *DefaultTrustEvaluator {
+    return &DefaultTrustEvaluator{
+        devices:      devices,
+        geo:          geo,
+        profileStore: profileStore,
+    }
+}
+
+func (e *DefaultTrustEvaluator) Evaluate(ctx context.Context, user *User, req AuthRequest, mfaMethod MFAMethod) (TrustFactors, error) {
+    now := time.Now()
+
+    deviceScore, err := e.devices.Score(user.ID, req.DeviceID, req.UserAgent, req.AcceptLanguage)
+    if err != nil {
+        return TrustFactors{}, err
+    }
+
+    point, err := e.geo.Locate(req.IPAddress)
+    if err != nil {
+        return TrustFactors{}, err
+    }
+
+    profile, found, err := e.profileStore.Get(user.ID)
+    if err != nil {
+        return TrustFactors{}, err
+    }
+
+    var locationScore, behaviorScore, timeScore float64
+    if !found {
+        // First observed login: nothing to compare against yet, so trust it
+        // and let it seed the profile.
+        locationScore = 1.0
+        behaviorScore = 0.5
+        timeScore = 0.5
+    } else {
+        sinceLastLoginHours := now.Sub(profile.LastLoginAt).Hours()
+        locationScore = locationFactor(point, profile.centroid(), sinceLastLoginHours)
+        behaviorScore = behaviorFactor(profile, now)
+        timeScore = timeFactor(profile, now)
+    }
+
+    if _, err := e.profileStore.RecordLogin(user.ID, point, now); err != nil {
+        return TrustFactors{}, err
+    }
+
+    return TrustFactors{
+        MFA:      mfaFactor(mfaMethod),
+        Device:   deviceScore,
+        Location: locationScore,
+        Behavior: behaviorScore,
+        Time:     timeScore,
+    }, nil
+}
@@ -0,0 +1,141 @@
+// notification_service/apns.go
+package main
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/sideshow/apns2"
+    "github.com/sideshow/apns2/payload"
+    "github.com/sideshow/apns2/token"
+)
+
+// apnsPriorityHigh and apnsPriorityNormal mirror APNs' own priority values:
+// 10 sends the push immediately, 5 lets Apple batch it for power efficiency.
+const (
+    apnsPriorityHigh   = 10
+    apnsPriorityNormal = 5
+)
+
+// APNSProvider talks to Apple's HTTP/2 endpoint directly using token-based
+// (P8 key) authentication, bypassing FCM's APNs payload wrapper.
+type APNSProvider struct {
+    client  *apns2.Client
+    topic   string
+    enabled bool
+}
+
+// NewAPNSProvider builds a TokenAuthenticator from APNS_KEY_ID, APNS_TEAM_ID,
+// and APNS_BUNDLE_ID plus the P8 key at APNS_KEY_PATH. Loading the P8 key is
+// the one step here that can fail outright (a bad path or malformed key), so
+// that's a hard error; missing config, by contrast, just disables the
+// provider and makes Send return an error, since Android-only deployments
+// have no Apple credentials to give it.
+func NewAPNSProvider() (*APNSProvider, error) {
+    keyPath := os.Getenv("APNS_KEY_PATH")
+    keyID := os.Getenv("APNS_KEY_ID")
+    teamID := os.Getenv("APNS_TEAM_ID")
+    bundleID := os.Getenv("APNS_BUNDLE_ID")
+
+    if keyPath == "" || keyID == "" || teamID == "" || bundleID == "" {
+        return &APNSProvider{enabled: false}, nil
+    }
+
+    authKey, err := token.AuthKeyFromFile(keyPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load APNs signing key: %v", err)
+    }
+
+    authToken := &token.Token{
+        AuthKey: authKey,
+        KeyID:   keyID,
+        TeamID:  teamID,
+    }
+
+    client := apns2.NewTokenClient(authToken)
+    if os.Getenv("APNS_ENVIRONMENT") == "production" {
+        client = client.Production()
+    } else {
+        client = client.Development()
+    }
+
+    return &APNSProvider{
+        client:  client,
+        topic:   bundleID,
+        enabled: true,
+    }, nil
+}
+
+// Send builds an APNs payload (alert title/body, badge, sound,
+// content-available, mutable-content, thread-id, category) from the request
+// fields and pushes it directly to Apple, returning the apns-id.
+func (p *APNSProvider) Send(recipient Recipient, title, body string, data map[string]interface{}, priority string) (string, error) {
+    if !p.enabled {
+        return "", fmt.Errorf("APNs provider not configured")
+    }
+
+    pl := payload.NewPayload().
+        AlertTitle(title).
+        AlertBody(body).
+        Sound("default")
+
+    if badge, ok := data["badge"]; ok {
+        if n, ok := toInt(badge); ok {
+            pl = pl.Badge(n)
+        }
+    }
+    if contentAvailable, ok := data["content_available"].(bool); ok && contentAvailable {
+        pl = pl.ContentAvailable()
+    }
+    if mutableContent, ok := data["mutable_content"].(bool); ok && mutableContent {
+        pl = pl.MutableContent()
+    }
+    if threadID, ok := data["thread_id"].(string); ok {
+        pl = pl.ThreadID(threadID)
+    }
+    if category, ok := data["category"].(string); ok {
+        pl = pl.Category(category)
+    }
+
+    for key, value := range data {
+        switch key {
+        case "badge", "content_available", "mutable_content", "thread_id", "category":
+            continue
+        default:
+            pl = pl.Custom(key, value)
+        }
+    }
+
+    notification := &apns2.Notification{
+        DeviceToken: recipient.DeviceToken,
+        Topic:       p.topic,
+        Payload:     pl,
+        Priority:    apnsPriorityNormal,
+    }
+
+    if priority == "high" {
+        notification.Priority = apnsPriorityHigh
+    }
+
+    res, err := p.client.Push(notification)
+    if err != nil {
+        return "", fmt.Errorf("failed to send APNs notification: %v", err)
+    }
+
+    if !res.Sent() {
+        return "", fmt.Errorf("APNs rejected notification: %s (status %d, apns-id %s)", res.Reason, res.StatusCode, res.ApnsID)
+    }
+
+    return res.ApnsID, nil
+}
+
+func toInt(v interface{}) (int, bool) {
+    switch n := v.(type) {
+    case int:
+        return n, true
+    case float64:
+        return int(n), true
+    default:
+        return 0, false
+    }
+}
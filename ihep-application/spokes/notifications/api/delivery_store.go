@@ -0,0 +1,172 @@
+// notification_service/delivery_store.go
+package main
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+// DeliveryStatus tracks a single recipient/channel delivery task through the
+// queue. A Delivery aggregates one status per fan-out recipient so callers
+// can poll GET /v1/notifications/{delivery_id} for the whole request.
+type DeliveryStatus string
+
+const (
+    StatusQueued     DeliveryStatus = "queued"
+    StatusSending    DeliveryStatus = "sending"
+    StatusSent       DeliveryStatus = "sent"
+    StatusFailed     DeliveryStatus = "failed"
+    StatusDeadLetter DeliveryStatus = "dead_letter"
+)
+
+type RecipientDeliveryStatus struct {
+    RecipientID string           `json:"recipient_id"`
+    Channel     NotificationType `json:"channel"`
+    Status      DeliveryStatus   `json:"status"`
+    MessageID   string           `json:"message_id,omitempty"`
+    Error       string           `json:"error,omitempty"`
+    Attempts    int              `json:"attempts"`
+}
+
+type Delivery struct {
+    ID         string                              `json:"delivery_id"`
+    Recipients map[string]*RecipientDeliveryStatus `json:"recipients"`
+    CreatedAt  time.Time                           `json:"created_at"`
+    UpdatedAt  time.Time                           `json:"updated_at"`
+}
+
+// OverallStatus derives a single status for the delivery from its
+// per-recipient tasks: sending while any task is still queued or sending,
+// failed if anything landed in the dead letter sink, sent once everything
+// succeeded.
+func (d *Delivery) OverallStatus() DeliveryStatus {
+    sawDead := false
+    sawPending := false
+
+    for _, r := range d.Recipients {
+        switch r.Status {
+        case StatusDeadLetter:
+            sawDead = true
+        case StatusQueued, StatusSending:
+            sawPending = true
+        }
+    }
+
+    if sawPending {
+        return StatusSending
+    }
+    if sawDead {
+        return StatusFailed
+    }
+    return StatusSent
+}
+
+// DeliveryStore persists delivery status for GET /v1/notifications/{id}
+// lookups. The worker pool fans out across many goroutines (and, with a
+// shared backend, many instances), all calling UpdateRecipient for the same
+// delivery concurrently, so implementations beyond the in-memory one here
+// need their own Redis/DynamoDB-appropriate locking, not just a map.
+//
+// Snapshot, not Get, is the read path: callers serializing a Delivery need
+// its Recipients map to stop changing underneath them, and worker goroutines
+// are writing to that same map via UpdateRecipient for as long as the
+// delivery is in flight.
+type DeliveryStore interface {
+    Create(delivery *Delivery) error
+    Snapshot(id string) (*Delivery, error)
+    UpdateRecipient(deliveryID, taskID string, status RecipientDeliveryStatus) error
+}
+
+type InMemoryDeliveryStore struct {
+    mu         sync.RWMutex
+    deliveries map[string]*Delivery
+}
+
+func NewInMemoryDeliveryStore() *InMemoryDeliveryStore {
+    return &InMemoryDeliveryStore{
+        deliveries: make(map[string]*Delivery),
+    }
+}
+
+func (s *InMemoryDeliveryStore) Create(delivery *Delivery) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.deliveries[delivery.ID] = delivery
+    return nil
+}
+
+// Snapshot returns a point-in-time copy of the delivery, with its own copy
+// of the Recipients map, taken while holding the store's lock. Returning the
+// live *Delivery here would hand the caller a map that worker goroutines are
+// still writing to via UpdateRecipient, which is an unsynchronized
+// concurrent map access once the caller ranges over it outside the lock.
+func (s *InMemoryDeliveryStore) Snapshot(id string) (*Delivery, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    delivery, ok := s.deliveries[id]
+    if !ok {
+        return nil, fmt.Errorf("delivery %s not found", id)
+    }
+
+    recipients := make(map[string]*RecipientDeliveryStatus, len(delivery.Recipients))
+    for taskID, status := range delivery.Recipients {
+        copied := *status
+        recipients[taskID] = &copied
+    }
+
+    return &Delivery{
+        ID:         delivery.ID,
+        Recipients: recipients,
+        CreatedAt:  delivery.CreatedAt,
+        UpdatedAt:  delivery.UpdatedAt,
+    }, nil
+}
+
+func (s *InMemoryDeliveryStore) UpdateRecipient(deliveryID, taskID string, status RecipientDeliveryStatus) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delivery, ok := s.deliveries[deliveryID]
+    if !ok {
+        return fmt.Errorf("delivery %s not found", deliveryID)
+    }
+
+    delivery.Recipients[taskID] = &status
+    delivery.UpdatedAt = time.Now().UTC()
+    return nil
+}
+
+// DeadLetterSink records tasks that exhausted their retries with a terminal
+// or repeated-retryable error, so operators can inspect and replay them.
+type DeadLetterSink interface {
+    Put(task DeliveryTask, reason string) error
+}
+
+type deadLetterEntry struct {
+    Task      DeliveryTask
+    Reason    string
+    Timestamp time.Time
+}
+
+type InMemoryDeadLetterSink struct {
+    mu      sync.Mutex
+    entries []deadLetterEntry
+}
+
+func NewInMemoryDeadLetterSink() *InMemoryDeadLetterSink {
+    return &InMemoryDeadLetterSink{}
+}
+
+func (d *InMemoryDeadLetterSink) Put(task DeliveryTask, reason string) error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    d.entries = append(d.entries, deadLetterEntry{
+        Task:      task,
+        Reason:    reason,
+        Timestamp: time.Now().UTC(),
+    })
+    return nil
+}
@@ -3,11 +3,17 @@ package main
 
 import (
     "context"
+    "crypto/rand"
+    "encoding/hex"
     "encoding/json"
     "fmt"
     "log"
     "net/http"
     "os"
+    "os/signal"
+    "strconv"
+    "sync"
+    "syscall"
     "time"
 
     "github.com/aws/aws-sdk-go/aws"
@@ -26,13 +32,34 @@ const (
     TypeEmail    NotificationType = "email"
     TypePush     NotificationType = "push"
     TypeAlert    NotificationType = "alert"
+    TypeTelegram NotificationType = "telegram"
+)
+
+// Platform identifies how a recipient's push token should be delivered.
+// Recipients are routed per-platform so a single request can fan out to a
+// mix of Apple-direct, FCM-Android, and web tokens.
+type Platform string
+
+const (
+    PlatformIOSAPNS    Platform = "ios_apns"
+    PlatformIOSFCM     Platform = "ios_fcm"
+    PlatformAndroidFCM Platform = "android_fcm"
+    PlatformWeb        Platform = "web"
 )
 
 type Recipient struct {
-    UserID     string `json:"user_id"`
-    Email      string `json:"email,omitempty"`
-    PhoneNumber string `json:"phone_number,omitempty"`
-    DeviceToken string `json:"device_token,omitempty"`
+    UserID      string   `json:"user_id"`
+    Email       string   `json:"email,omitempty"`
+    PhoneNumber string   `json:"phone_number,omitempty"`
+    DeviceToken string   `json:"device_token,omitempty"`
+    Platform    Platform `json:"platform,omitempty"`
+    Locale      string   `json:"locale,omitempty"`
+    TelegramChatID string `json:"telegram_chat_id,omitempty"`
+    // AccountID and DeviceID are populated when a recipient was resolved
+    // from a registered subscriber rather than supplied inline, so a
+    // terminal delivery error can drop the stale registration.
+    AccountID string `json:"-"`
+    DeviceID  string `json:"-"`
 }
 
 type NotificationRequest struct {
@@ -43,19 +70,28 @@ type NotificationRequest struct {
     Priority    string           `json:"priority"` // high, normal
     Data        map[string]interface{} `json:"data,omitempty"`
     TemplateID  string           `json:"template_id,omitempty"`
+    Locale      string           `json:"locale,omitempty"`
 }
 
-type NotificationResponse struct {
-    Success     bool     `json:"success"`
-    MessageIDs  []string `json:"message_ids,omitempty"`
-    FailedRecipients []string `json:"failed_recipients,omitempty"`
-    Timestamp   string   `json:"timestamp"`
+// DeliveryAcceptedResponse is returned for the async send path: the request
+// has been queued, not delivered, so callers poll the delivery_id for status.
+type DeliveryAcceptedResponse struct {
+    DeliveryID string `json:"delivery_id"`
+    Status     string `json:"status"`
 }
 
 type NotificationService struct {
-    snsClient *sns.SNS
-    sesClient *ses.SES
-    fcmClient *firebase_messaging.Client
+    snsClient        *sns.SNS
+    sesClient        *ses.SES
+    fcmClient        *firebase_messaging.Client
+    apnsClient       *APNSProvider
+    telegramProvider *TelegramProvider
+    deliveryQueue    chan DeliveryTask
+    deliveryStore    DeliveryStore
+    deadLetterSink   DeadLetterSink
+    subscriberStore  SubscriberStore
+    templateRegistry TemplateRegistry
+    workerWG         sync.WaitGroup
 }
 
 func NewNotificationService() (*NotificationService, error) {
@@ -79,13 +115,63 @@ func NewNotificationService() (*NotificationService, error) {
         return nil, fmt.Errorf("failed to get FCM client: %v", err)
     }
 
+    apnsClient, err := NewAPNSProvider()
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize APNs provider: %v", err)
+    }
+
+    templatesDir := os.Getenv("TEMPLATES_DIR")
+    if templatesDir == "" {
+        templatesDir = "./templates"
+    }
+    templateRegistry, err := NewFileTemplateRegistry(templatesDir)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load notification templates: %v", err)
+    }
+
+    telegramProvider := NewTelegramProvider(os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_BOT_USERNAME"), os.Getenv("TELEGRAM_WEBHOOK_SECRET"))
+
+    subscriberStore, err := newSubscriberStore(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize subscriber store: %v", err)
+    }
+
     return &NotificationService{
-        snsClient: sns.New(sess),
-        sesClient: ses.New(sess),
-        fcmClient: fcmClient,
+        snsClient:        sns.New(sess),
+        sesClient:        ses.New(sess),
+        fcmClient:        fcmClient,
+        apnsClient:       apnsClient,
+        telegramProvider: telegramProvider,
+        deliveryQueue:    make(chan DeliveryTask, deliveryQueueSize),
+        deliveryStore:    NewInMemoryDeliveryStore(),
+        deadLetterSink:   NewInMemoryDeadLetterSink(),
+        subscriberStore:  subscriberStore,
+        templateRegistry: templateRegistry,
     }, nil
 }
 
+// newSubscriberStore builds the SubscriberStore subscriber registrations are
+// persisted to. SUBSCRIBER_DB_DSN, when set, connects to the Postgres-backed
+// store so registrations survive a restart; without it, NOTIFICATIONS_ENVIRONMENT=production
+// refuses to boot rather than silently losing every subscriber on deploy,
+// and anywhere else it falls back to the in-memory store.
+func newSubscriberStore(ctx context.Context) (SubscriberStore, error) {
+    if dsn := os.Getenv("SUBSCRIBER_DB_DSN"); dsn != "" {
+        store, err := NewPostgresSubscriberStore(ctx, dsn)
+        if err != nil {
+            return nil, err
+        }
+        return store, nil
+    }
+
+    if os.Getenv("NOTIFICATIONS_ENVIRONMENT") == "production" {
+        return nil, fmt.Errorf("SUBSCRIBER_DB_DSN must be set in production; refusing to boot with the in-memory subscriber store")
+    }
+
+    log.Printf("warning: SUBSCRIBER_DB_DSN is not set; falling back to InMemorySubscriberStore, which loses all subscribers on restart")
+    return NewInMemorySubscriberStore(), nil
+}
+
 func (s *NotificationService) sendSMS(recipient Recipient, message string) (string, error) {
     input := &sns.PublishInput{
         Message:     aws.String(message),
@@ -106,18 +192,26 @@ func (s *NotificationService) sendSMS(recipient Recipient, message string) (stri
     return *result.MessageId, nil
 }
 
-func (s *NotificationService) sendEmail(recipient Recipient, subject, body string) (string, error) {
+func (s *NotificationService) sendEmail(recipient Recipient, subject, textBody, htmlBody string) (string, error) {
+    body := &ses.Body{
+        Text: &ses.Content{
+            Charset: aws.String("UTF-8"),
+            Data:    aws.String(textBody),
+        },
+    }
+    if htmlBody != "" {
+        body.Html = &ses.Content{
+            Charset: aws.String("UTF-8"),
+            Data:    aws.String(htmlBody),
+        }
+    }
+
     input := &ses.SendEmailInput{
         Destination: &ses.Destination{
             ToAddresses: []*string{aws.String(recipient.Email)},
         },
         Message: &ses.Message{
-            Body: &ses.Body{
-                Text: &ses.Content{
-                    Charset: aws.String("UTF-8"),
-                    Data:    aws.String(body),
-                },
-            },
+            Body: body,
             Subject: &ses.Content{
                 Charset: aws.String("UTF-8"),
                 Data:    aws.String(subject),
@@ -134,14 +228,18 @@ func (s *NotificationService) sendEmail(recipient Recipient, subject, body strin
     return *result.MessageId, nil
 }
 
-func (s *NotificationService) sendPushNotification(recipient Recipient, title, body string, data map[string]interface{}) error {
+func (s *NotificationService) sendPushNotification(recipient Recipient, title, body string, data map[string]interface{}, priority string) (string, error) {
+    if recipient.Platform == PlatformIOSAPNS {
+        return s.apnsClient.Send(recipient, title, body, data, priority)
+    }
+
     message := &firebase_messaging.Message{
         Token: recipient.DeviceToken,
         Notification: &firebase_messaging.Notification{
             Title: title,
             Body:  body,
         },
-        Data: data,
+        Data: stringifyData(data),
         Android: &firebase_messaging.AndroidConfig{
             Priority: "high",
             Notification: &firebase_messaging.AndroidNotification{
@@ -161,49 +259,32 @@ func (s *NotificationService) sendPushNotification(recipient Recipient, title, b
         },
     }
 
-    _, err := s.fcmClient.Send(context.Background(), message)
-    return err
+    msgID, err := s.fcmClient.Send(context.Background(), message)
+    return msgID, err
 }
 
-func (s *NotificationService) sendNotification(req NotificationRequest) (*NotificationResponse, error) {
-    response := &NotificationResponse{
-        Success:          true,
-        MessageIDs:       make([]string, 0),
-        FailedRecipients: make([]string, 0),
-        Timestamp:        time.Now().UTC().Format(time.RFC3339),
-    }
-
-    for _, recipient := range req.Recipients {
-        var messageID string
-        var err error
-
-        switch req.Type {
-        case TypeSMS:
-            messageID, err = s.sendSMS(recipient, req.Message)
-        case TypeEmail:
-            messageID, err = s.sendEmail(recipient, req.Title, req.Message)
-        case TypePush:
-            err = s.sendPushNotification(recipient, req.Title, req.Message, req.Data)
-            messageID = fmt.Sprintf("push_%d", time.Now().UnixNano())
-        default:
-            response.FailedRecipients = append(response.FailedRecipients, recipient.UserID)
-            continue
-        }
+// stringifyData converts the caller-supplied custom data map to the
+// map[string]string FCM requires, since Data.Data values travel to the
+// client as opaque key/value strings regardless of their original type.
+func stringifyData(data map[string]interface{}) map[string]string {
+    if data == nil {
+        return nil
+    }
 
-        if err != nil {
-            log.Printf("Failed to send %s to recipient %s: %v", req.Type, recipient.UserID, err)
-            response.FailedRecipients = append(response.FailedRecipients, recipient.UserID)
-            response.Success = false
+    out := make(map[string]string, len(data))
+    for k, v := range data {
+        if s, ok := v.(string); ok {
+            out[k] = s
         } else {
-            if messageID != "" {
-                response.MessageIDs = append(response.MessageIDs, messageID)
-            }
+            out[k] = fmt.Sprintf("%v", v)
         }
     }
-
-    return response, nil
+    return out
 }
 
+// sendNotificationHandler enqueues one delivery task per (recipient, channel)
+// and returns immediately with a delivery_id; the worker pool performs the
+// actual sends so a slow or failing provider never stalls the caller.
 func (s *NotificationService) sendNotificationHandler(w http.ResponseWriter, r *http.Request) {
     var req NotificationRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -211,15 +292,114 @@ func (s *NotificationService) sendNotificationHandler(w http.ResponseWriter, r *
         return
     }
 
-    response, err := s.sendNotification(req)
+    deliveryID, err := newDeliveryID()
+    if err != nil {
+        log.Printf("failed to generate delivery id: %v", err)
+        http.Error(w, "Failed to queue notifications", http.StatusInternalServerError)
+        return
+    }
+
+    delivery := &Delivery{
+        ID:         deliveryID,
+        Recipients: make(map[string]*RecipientDeliveryStatus, len(req.Recipients)),
+        CreatedAt:  time.Now().UTC(),
+        UpdatedAt:  time.Now().UTC(),
+    }
+
+    tasks := make([]DeliveryTask, 0, len(req.Recipients))
+    taskIndex := 0
+    for _, rawRecipient := range req.Recipients {
+        recipients, err := s.resolveRecipients(rawRecipient, req.Type)
+        if err != nil {
+            log.Printf("failed to resolve recipient %s: %v", rawRecipient.UserID, err)
+            continue
+        }
+
+        for _, recipient := range recipients {
+            title, message, htmlMessage := req.Title, req.Message, ""
+
+            if req.TemplateID != "" {
+                locale := resolveLocale(recipient.Locale, req.Locale)
+                rendered, err := s.templateRegistry.Render(req.TemplateID, locale, req.Data)
+                if err != nil {
+                    log.Printf("failed to render template %s for recipient %s: %v", req.TemplateID, recipient.UserID, err)
+                    http.Error(w, fmt.Sprintf("template rendering failed: %v", err), http.StatusBadRequest)
+                    return
+                }
+                title, message, htmlMessage = rendered.Subject, rendered.Text, rendered.HTML
+            }
+
+            taskID := fmt.Sprintf("%s-%d", deliveryID, taskIndex)
+            taskIndex++
+
+            delivery.Recipients[taskID] = &RecipientDeliveryStatus{
+                RecipientID: recipient.UserID,
+                Channel:     req.Type,
+                Status:      StatusQueued,
+            }
+            tasks = append(tasks, DeliveryTask{
+                DeliveryID:  deliveryID,
+                TaskID:      taskID,
+                Recipient:   recipient,
+                Channel:     req.Type,
+                Title:       title,
+                Message:     message,
+                HTMLMessage: htmlMessage,
+                Priority:    req.Priority,
+                Data:        req.Data,
+            })
+        }
+    }
+
+    if err := s.deliveryStore.Create(delivery); err != nil {
+        log.Printf("failed to persist delivery %s: %v", deliveryID, err)
+        http.Error(w, "Failed to queue notifications", http.StatusInternalServerError)
+        return
+    }
+
+    for _, task := range tasks {
+        if err := s.PublishDeliveryTask(task); err != nil {
+            log.Printf("failed to enqueue task %s: %v", task.TaskID, err)
+            http.Error(w, "Delivery queue is saturated, try again shortly", http.StatusServiceUnavailable)
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(DeliveryAcceptedResponse{
+        DeliveryID: deliveryID,
+        Status:     string(StatusQueued),
+    })
+}
+
+// deliveryStatusHandler serves GET /v1/notifications/{delivery_id}, reporting
+// the aggregate status plus each recipient's individual outcome.
+func (s *NotificationService) deliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
+    deliveryID := mux.Vars(r)["delivery_id"]
+
+    delivery, err := s.deliveryStore.Snapshot(deliveryID)
     if err != nil {
-        log.Printf("Failed to send notifications: %v", err)
-        http.Error(w, "Failed to send notifications", http.StatusInternalServerError)
+        http.Error(w, "Delivery not found", http.StatusNotFound)
         return
     }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "delivery_id": delivery.ID,
+        "status":      delivery.OverallStatus(),
+        "recipients":  delivery.Recipients,
+        "created_at":  delivery.CreatedAt,
+        "updated_at":  delivery.UpdatedAt,
+    })
+}
+
+func newDeliveryID() (string, error) {
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return "dlv_" + hex.EncodeToString(buf), nil
 }
 
 func main() {
@@ -228,8 +408,21 @@ func main() {
         log.Fatalf("Failed to initialize notification service: %v", err)
     }
 
+    workerCount := 8
+    if n, err := strconv.Atoi(os.Getenv("DELIVERY_WORKERS")); err == nil && n > 0 {
+        workerCount = n
+    }
+    service.StartWorkerPool(workerCount)
+
     r := mux.NewRouter()
     r.HandleFunc("/v1/notifications/send", service.sendNotificationHandler).Methods("POST")
+    r.HandleFunc("/v1/notifications/{delivery_id}", service.deliveryStatusHandler).Methods("GET")
+    r.HandleFunc("/v1/subscribers", service.registerSubscriberHandler).Methods("POST")
+    r.HandleFunc("/v1/subscribers", service.deleteSubscriberHandler).Methods("DELETE")
+    r.HandleFunc("/v1/subscribers/{account_id}", service.listSubscribersHandler).Methods("GET")
+    r.HandleFunc("/v1/templates/preview", service.previewTemplateHandler).Methods("POST")
+    r.HandleFunc("/v1/telegram/verify/start", service.telegramVerifyStartHandler).Methods("POST")
+    r.HandleFunc("/v1/telegram/webhook", service.telegramWebhookHandler).Methods("POST")
     r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusOK)
         json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
@@ -240,6 +433,29 @@ func main() {
         port = "8080"
     }
 
-    log.Printf("Notification Service starting on port %s", port)
-    log.Fatal(http.ListenAndServe(":"+port, r))
+    srv := &http.Server{
+        Addr:    ":" + port,
+        Handler: r,
+    }
+
+    go func() {
+        log.Printf("Notification Service starting on port %s", port)
+        if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Fatalf("Notification Service failed: %v", err)
+        }
+    }()
+
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    <-stop
+
+    log.Println("Shutting down, draining delivery queue...")
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        log.Printf("HTTP server shutdown error: %v", err)
+    }
+
+    service.Shutdown()
+    log.Println("Delivery queue drained, exiting")
 }
@@ -0,0 +1,188 @@
+// notification_service/queue.go
+package main
+
+import (
+    "fmt"
+    "log"
+    "math/rand"
+    "strings"
+    "time"
+)
+
+const (
+    deliveryQueueSize   = 1000
+    maxDeliveryAttempts = 4
+    baseRetryBackoff    = 250 * time.Millisecond
+)
+
+// DeliveryTask is one (recipient, channel) unit of work dequeued by a worker.
+// It carries everything needed to retry independently of the rest of the
+// request it was fanned out from.
+type DeliveryTask struct {
+    DeliveryID  string
+    TaskID      string
+    Recipient   Recipient
+    Channel     NotificationType
+    Title       string
+    Message     string
+    HTMLMessage string
+    Priority    string
+    Data        map[string]interface{}
+    Attempt     int
+}
+
+// PublishDeliveryTask enqueues a task for the worker pool to pick up. It
+// never blocks the HTTP request past the queue's buffer: a full queue means
+// the pool is saturated and the caller should back off.
+func (s *NotificationService) PublishDeliveryTask(task DeliveryTask) error {
+    select {
+    case s.deliveryQueue <- task:
+        return nil
+    default:
+        return fmt.Errorf("delivery queue is full")
+    }
+}
+
+// ConsumeDeliveryTasks is the worker loop started by StartWorkerPool. Workers
+// keep pulling tasks until the queue channel is closed during shutdown.
+func (s *NotificationService) ConsumeDeliveryTasks(workerID int) {
+    defer s.workerWG.Done()
+
+    for task := range s.deliveryQueue {
+        s.processDeliveryTask(task)
+    }
+}
+
+// StartWorkerPool launches n worker goroutines consuming from the shared
+// delivery queue.
+func (s *NotificationService) StartWorkerPool(n int) {
+    for i := 0; i < n; i++ {
+        s.workerWG.Add(1)
+        go s.ConsumeDeliveryTasks(i)
+    }
+}
+
+// Shutdown closes the delivery queue so workers drain any remaining tasks
+// and exit, then waits for them to finish.
+func (s *NotificationService) Shutdown() {
+    close(s.deliveryQueue)
+    s.workerWG.Wait()
+}
+
+func (s *NotificationService) processDeliveryTask(task DeliveryTask) {
+    var lastErr error
+    attempts := task.Attempt
+
+    for attempt := task.Attempt; attempt < maxDeliveryAttempts; attempt++ {
+        attempts = attempt + 1
+        messageID, err := s.deliverTask(task)
+        if err == nil {
+            s.recordStatus(task, RecipientDeliveryStatus{
+                RecipientID: task.Recipient.UserID,
+                Channel:     task.Channel,
+                Status:      StatusSent,
+                MessageID:   messageID,
+                Attempts:    attempt + 1,
+            })
+            return
+        }
+
+        lastErr = err
+        if !isRetryableError(task.Channel, err) {
+            s.dropStaleSubscriber(task.Recipient, err)
+            break
+        }
+
+        if attempt < maxDeliveryAttempts-1 {
+            time.Sleep(retryBackoff(attempt))
+        }
+    }
+
+    log.Printf("delivery %s task %s failed for recipient %s after %d attempt(s): %v", task.DeliveryID, task.TaskID, task.Recipient.UserID, attempts, lastErr)
+
+    s.recordStatus(task, RecipientDeliveryStatus{
+        RecipientID: task.Recipient.UserID,
+        Channel:     task.Channel,
+        Status:      StatusDeadLetter,
+        Error:       lastErr.Error(),
+        Attempts:    attempts,
+    })
+
+    if err := s.deadLetterSink.Put(task, lastErr.Error()); err != nil {
+        log.Printf("failed to record dead letter for delivery %s task %s: %v", task.DeliveryID, task.TaskID, err)
+    }
+}
+
+func (s *NotificationService) recordStatus(task DeliveryTask, status RecipientDeliveryStatus) {
+    if err := s.deliveryStore.UpdateRecipient(task.DeliveryID, task.TaskID, status); err != nil {
+        log.Printf("failed to update delivery status for %s/%s: %v", task.DeliveryID, task.TaskID, err)
+    }
+}
+
+// deliverTask performs the actual send for a single task, reusing the
+// per-channel send methods that the synchronous handler used to call
+// directly.
+func (s *NotificationService) deliverTask(task DeliveryTask) (string, error) {
+    switch task.Channel {
+    case TypeSMS:
+        return s.sendSMS(task.Recipient, task.Message)
+    case TypeEmail:
+        return s.sendEmail(task.Recipient, task.Title, task.Message, task.HTMLMessage)
+    case TypePush:
+        return s.sendPushNotification(task.Recipient, task.Title, task.Message, task.Data, task.Priority)
+    case TypeTelegram:
+        return s.telegramProvider.Send(task.Recipient.TelegramChatID, task.Message, task.Data)
+    default:
+        return "", fmt.Errorf("unsupported channel: %s", task.Channel)
+    }
+}
+
+// retryBackoff returns an exponential delay plus a random jitter of up to
+// that same delay, so retries across a burst of failing tasks don't all land
+// on the provider at once.
+func retryBackoff(attempt int) time.Duration {
+    base := baseRetryBackoff * time.Duration(1<<uint(attempt))
+    jitter := time.Duration(rand.Int63n(int64(base) + 1))
+    return base + jitter
+}
+
+// isRetryableError classifies provider errors as transient (worth a retry)
+// or terminal (token invalid, unsubscribed, etc. — retrying wastes quota).
+func isRetryableError(channel NotificationType, err error) bool {
+    msg := strings.ToLower(err.Error())
+
+    terminalMarkers := []string{
+        "invalid",
+        "unsubscribed",
+        "not registered",
+        "not-registered",
+        "unregistered",
+        "410",
+        "invalidparameter",
+        "unauthorized",
+    }
+    for _, marker := range terminalMarkers {
+        if strings.Contains(msg, marker) {
+            return false
+        }
+    }
+
+    retryableMarkers := []string{
+        "throttl",
+        "unavailable",
+        "timeout",
+        "temporarily",
+        "429",
+        "500",
+        "502",
+        "503",
+    }
+    for _, marker := range retryableMarkers {
+        if strings.Contains(msg, marker) {
+            return true
+        }
+    }
+
+    // Default to retrying unrecognized errors; the attempt cap bounds cost.
+    return true
+}
@@ -0,0 +1,34 @@
+// notification_service/queue_test.go
+package main
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestIsRetryableErrorClassifiesAPNsRejections(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want bool
+    }{
+        {
+            name: "apns unregistered device is terminal",
+            err:  fmt.Errorf("APNs rejected notification: Unregistered (status 410, apns-id abc-123)"),
+            want: false,
+        },
+        {
+            name: "throttled send is retryable",
+            err:  fmt.Errorf("apns2: too many requests (status 429)"),
+            want: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isRetryableError(TypePush, tt.err); got != tt.want {
+                t.Errorf("isRetryableError(%q) = %v, want %v", tt.err, got, tt.want)
+            }
+        })
+    }
+}
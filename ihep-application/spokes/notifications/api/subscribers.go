@@ -0,0 +1,253 @@
+// notification_service/subscribers.go
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// SubscriberProvider is the delivery channel a registered device uses.
+type SubscriberProvider string
+
+const (
+    ProviderFirebase SubscriberProvider = "firebase"
+    ProviderApple    SubscriberProvider = "apple"
+    ProviderWeb      SubscriberProvider = "web"
+    ProviderSMS      SubscriberProvider = "sms"
+    ProviderEmail    SubscriberProvider = "email"
+    ProviderTelegram SubscriberProvider = "telegram"
+)
+
+// NotificationSubscriber is a single registered device/address for an
+// account. Callers no longer need to pass tokens inline on every send;
+// instead they register once and NotificationRequest.Recipients can just
+// reference the account ID.
+type NotificationSubscriber struct {
+    AccountID   string             `json:"account_id"`
+    Provider    SubscriberProvider `json:"provider"`
+    DeviceID    string             `json:"device_id"`
+    DeviceToken string             `json:"device_token"`
+    UserAgent   string             `json:"user_agent,omitempty"`
+    Locale      string             `json:"locale,omitempty"`
+    CreatedAt   time.Time          `json:"created_at"`
+    LastSeen    time.Time          `json:"last_seen"`
+}
+
+// SubscriberStore persists subscriber registrations. The in-memory store is
+// the local/dev default; PostgresSubscriberStore backs production via pgx.
+type SubscriberStore interface {
+    Upsert(sub NotificationSubscriber) error
+    Delete(accountID, deviceID string) error
+    ListByAccount(accountID string) ([]NotificationSubscriber, error)
+}
+
+type InMemorySubscriberStore struct {
+    mu          sync.RWMutex
+    subscribers map[string]map[string]NotificationSubscriber // accountID -> deviceID -> subscriber
+}
+
+func NewInMemorySubscriberStore() *InMemorySubscriberStore {
+    return &InMemorySubscriberStore{
+        subscribers: make(map[string]map[string]NotificationSubscriber),
+    }
+}
+
+func (s *InMemorySubscriberStore) Upsert(sub NotificationSubscriber) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.subscribers[sub.AccountID]; !ok {
+        s.subscribers[sub.AccountID] = make(map[string]NotificationSubscriber)
+    }
+    s.subscribers[sub.AccountID][sub.DeviceID] = sub
+    return nil
+}
+
+func (s *InMemorySubscriberStore) Delete(accountID, deviceID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    devices, ok := s.subscribers[accountID]
+    if !ok {
+        return nil
+    }
+    delete(devices, deviceID)
+    return nil
+}
+
+func (s *InMemorySubscriberStore) ListByAccount(accountID string) ([]NotificationSubscriber, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    devices, ok := s.subscribers[accountID]
+    if !ok {
+        return nil, nil
+    }
+
+    subs := make([]NotificationSubscriber, 0, len(devices))
+    for _, sub := range devices {
+        subs = append(subs, sub)
+    }
+    return subs, nil
+}
+
+// registerSubscriberHandler upserts a subscriber by (account_id, device_id).
+func (s *NotificationService) registerSubscriberHandler(w http.ResponseWriter, r *http.Request) {
+    var sub NotificationSubscriber
+    if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if sub.AccountID == "" || sub.DeviceID == "" {
+        http.Error(w, "account_id and device_id are required", http.StatusBadRequest)
+        return
+    }
+
+    now := time.Now().UTC()
+    if sub.CreatedAt.IsZero() {
+        sub.CreatedAt = now
+    }
+    sub.LastSeen = now
+
+    if err := s.subscriberStore.Upsert(sub); err != nil {
+        http.Error(w, "Failed to register subscriber", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(sub)
+}
+
+// deleteSubscriberHandler removes a subscriber on logout/uninstall.
+func (s *NotificationService) deleteSubscriberHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        AccountID string `json:"account_id"`
+        DeviceID  string `json:"device_id"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if req.AccountID == "" || req.DeviceID == "" {
+        http.Error(w, "account_id and device_id are required", http.StatusBadRequest)
+        return
+    }
+
+    if err := s.subscriberStore.Delete(req.AccountID, req.DeviceID); err != nil {
+        http.Error(w, "Failed to delete subscriber", http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// listSubscribersHandler lists every device registered for an account.
+func (s *NotificationService) listSubscribersHandler(w http.ResponseWriter, r *http.Request) {
+    accountID := mux.Vars(r)["account_id"]
+    if accountID == "" {
+        http.Error(w, "account_id is required", http.StatusBadRequest)
+        return
+    }
+
+    subs, err := s.subscriberStore.ListByAccount(accountID)
+    if err != nil {
+        http.Error(w, "Failed to list subscribers", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(subs)
+}
+
+// resolveRecipients expands a recipient into one concrete delivery target
+// per matching subscriber when the caller only supplied a user_id, or
+// returns the recipient unchanged when it already carries a token/address.
+func (s *NotificationService) resolveRecipients(recipient Recipient, channel NotificationType) ([]Recipient, error) {
+    if recipient.Email != "" || recipient.PhoneNumber != "" || recipient.DeviceToken != "" || recipient.TelegramChatID != "" {
+        return []Recipient{recipient}, nil
+    }
+
+    subs, err := s.subscriberStore.ListByAccount(recipient.UserID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up subscribers for %s: %v", recipient.UserID, err)
+    }
+
+    var resolved []Recipient
+    for _, sub := range subs {
+        r, ok := subscriberToRecipient(sub, channel)
+        if ok {
+            resolved = append(resolved, r)
+        }
+    }
+    return resolved, nil
+}
+
+func subscriberToRecipient(sub NotificationSubscriber, channel NotificationType) (Recipient, bool) {
+    base := Recipient{
+        UserID:    sub.AccountID,
+        AccountID: sub.AccountID,
+        DeviceID:  sub.DeviceID,
+        Locale:    sub.Locale,
+    }
+
+    switch channel {
+    case TypeSMS:
+        if sub.Provider != ProviderSMS {
+            return Recipient{}, false
+        }
+        base.PhoneNumber = sub.DeviceToken
+    case TypeEmail:
+        if sub.Provider != ProviderEmail {
+            return Recipient{}, false
+        }
+        base.Email = sub.DeviceToken
+    case TypeTelegram:
+        if sub.Provider != ProviderTelegram {
+            return Recipient{}, false
+        }
+        base.TelegramChatID = sub.DeviceToken
+    case TypePush, TypeAlert:
+        switch sub.Provider {
+        case ProviderApple:
+            base.Platform = PlatformIOSAPNS
+        case ProviderFirebase:
+            base.Platform = PlatformAndroidFCM
+        case ProviderWeb:
+            base.Platform = PlatformWeb
+        default:
+            return Recipient{}, false
+        }
+        base.DeviceToken = sub.DeviceToken
+    default:
+        return Recipient{}, false
+    }
+
+    return base, true
+}
+
+// dropStaleSubscriber removes a subscriber once its provider reports the
+// token as unregistered, so dead devices self-clean instead of retrying
+// forever.
+func (s *NotificationService) dropStaleSubscriber(recipient Recipient, err error) {
+    if recipient.AccountID == "" || recipient.DeviceID == "" {
+        return
+    }
+
+    msg := strings.ToLower(err.Error())
+    if !strings.Contains(msg, "not registered") && !strings.Contains(msg, "not-registered") && !strings.Contains(msg, "unregistered") && !strings.Contains(msg, "410") {
+        return
+    }
+
+    if dropErr := s.subscriberStore.Delete(recipient.AccountID, recipient.DeviceID); dropErr != nil {
+        log.Printf("failed to drop stale subscriber %s/%s: %v", recipient.AccountID, recipient.DeviceID, dropErr)
+    }
+}
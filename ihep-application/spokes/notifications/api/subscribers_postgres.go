@@ -0,0 +1,81 @@
+// notification_service/subscribers_postgres.go
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresSubscriberStore is the production-grade SubscriberStore backend.
+// It upserts on the (account_id, device_id) primary key so repeat
+// registrations from the same device overwrite its provider, token, user
+// agent, locale, and last_seen while keeping the original created_at.
+type PostgresSubscriberStore struct {
+    pool *pgxpool.Pool
+}
+
+func NewPostgresSubscriberStore(ctx context.Context, connString string) (*PostgresSubscriberStore, error) {
+    pool, err := pgxpool.New(ctx, connString)
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to subscriber database: %v", err)
+    }
+
+    return &PostgresSubscriberStore{pool: pool}, nil
+}
+
+func (s *PostgresSubscriberStore) Upsert(sub NotificationSubscriber) error {
+    _, err := s.pool.Exec(context.Background(), `
+        INSERT INTO notification_subscribers
+            (account_id, provider, device_id, device_token, user_agent, locale, created_at, last_seen)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (account_id, device_id) DO UPDATE SET
+            provider = EXCLUDED.provider,
+            device_token = EXCLUDED.device_token,
+            user_agent = EXCLUDED.user_agent,
+            locale = EXCLUDED.locale,
+            last_seen = EXCLUDED.last_seen
+    `, sub.AccountID, sub.Provider, sub.DeviceID, sub.DeviceToken, sub.UserAgent, sub.Locale, sub.CreatedAt, sub.LastSeen)
+    if err != nil {
+        return fmt.Errorf("failed to upsert subscriber: %v", err)
+    }
+    return nil
+}
+
+func (s *PostgresSubscriberStore) Delete(accountID, deviceID string) error {
+    _, err := s.pool.Exec(context.Background(), `
+        DELETE FROM notification_subscribers WHERE account_id = $1 AND device_id = $2
+    `, accountID, deviceID)
+    if err != nil {
+        return fmt.Errorf("failed to delete subscriber: %v", err)
+    }
+    return nil
+}
+
+func (s *PostgresSubscriberStore) ListByAccount(accountID string) ([]NotificationSubscriber, error) {
+    rows, err := s.pool.Query(context.Background(), `
+        SELECT account_id, provider, device_id, device_token, user_agent, locale, created_at, last_seen
+        FROM notification_subscribers
+        WHERE account_id = $1
+    `, accountID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list subscribers: %v", err)
+    }
+    defer rows.Close()
+
+    var subs []NotificationSubscriber
+    for rows.Next() {
+        var sub NotificationSubscriber
+        var createdAt, lastSeen time.Time
+        if err := rows.Scan(&sub.AccountID, &sub.Provider, &sub.DeviceID, &sub.DeviceToken, &sub.UserAgent, &sub.Locale, &createdAt, &lastSeen); err != nil {
+            return nil, fmt.Errorf("failed to scan subscriber row: %v", err)
+        }
+        sub.CreatedAt = createdAt
+        sub.LastSeen = lastSeen
+        subs = append(subs, sub)
+    }
+
+    return subs, rows.Err()
+}
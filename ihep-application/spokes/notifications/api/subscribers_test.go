@@ -0,0 +1,49 @@
+// notification_service/subscribers_test.go
+package main
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestDropStaleSubscriberOnAPNsUnregistered(t *testing.T) {
+    store := NewInMemorySubscriberStore()
+    if err := store.Upsert(NotificationSubscriber{AccountID: "acct-1", DeviceID: "dev-1"}); err != nil {
+        t.Fatalf("Upsert() error = %v", err)
+    }
+
+    s := &NotificationService{subscriberStore: store}
+    recipient := Recipient{AccountID: "acct-1", DeviceID: "dev-1"}
+    err := fmt.Errorf("APNs rejected notification: Unregistered (status 410, apns-id abc-123)")
+
+    s.dropStaleSubscriber(recipient, err)
+
+    subs, lookupErr := store.ListByAccount("acct-1")
+    if lookupErr != nil {
+        t.Fatalf("ListByAccount() error = %v", lookupErr)
+    }
+    if len(subs) != 0 {
+        t.Fatalf("subscriber still present after a terminal APNs error, got %v", subs)
+    }
+}
+
+func TestDropStaleSubscriberIgnoresTransientErrors(t *testing.T) {
+    store := NewInMemorySubscriberStore()
+    if err := store.Upsert(NotificationSubscriber{AccountID: "acct-1", DeviceID: "dev-1"}); err != nil {
+        t.Fatalf("Upsert() error = %v", err)
+    }
+
+    s := &NotificationService{subscriberStore: store}
+    recipient := Recipient{AccountID: "acct-1", DeviceID: "dev-1"}
+    err := fmt.Errorf("apns2: too many requests (status 429)")
+
+    s.dropStaleSubscriber(recipient, err)
+
+    subs, lookupErr := store.ListByAccount("acct-1")
+    if lookupErr != nil {
+        t.Fatalf("ListByAccount() error = %v", lookupErr)
+    }
+    if len(subs) != 1 {
+        t.Fatalf("subscriber dropped on a transient error, got %v", subs)
+    }
+}
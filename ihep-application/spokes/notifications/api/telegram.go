@@ -0,0 +1,367 @@
+// notification_service/telegram.go
+package main
+
+import (
+    "bytes"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "math/big"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    telegramAPIBase   = "https://api.telegram.org"
+    telegramPINLength = 6
+    telegramPINTTL    = 10 * time.Minute
+
+    // telegramMaxPINAttempts is how many wrong /start guesses a single chat
+    // gets before it's locked out; at 6 digits a guesser otherwise has
+    // unlimited shots at the 1-in-a-million PIN within its TTL.
+    telegramMaxPINAttempts = 5
+    telegramAttemptLockout = 15 * time.Minute
+)
+
+// TelegramProvider sends messages through the Telegram Bot API and verifies
+// new chat subscriptions via the /start deep-link PIN flow.
+type TelegramProvider struct {
+    botToken      string
+    botUsername   string
+    webhookSecret string
+    httpClient    *http.Client
+
+    mu       sync.Mutex
+    pending  map[string]pendingTelegramVerification
+    attempts map[string]*telegramPINAttempts
+}
+
+type pendingTelegramVerification struct {
+    AccountID string
+    CreatedAt time.Time
+}
+
+// telegramPINAttempts tracks a guessing chat's failed /start attempts so
+// ResolvePIN can lock it out after telegramMaxPINAttempts.
+type telegramPINAttempts struct {
+    Failures    int
+    LockedUntil time.Time
+}
+
+// NewTelegramProvider builds a provider from TELEGRAM_BOT_TOKEN,
+// TELEGRAM_BOT_USERNAME, and TELEGRAM_WEBHOOK_SECRET (the secret_token
+// Telegram echoes back on every webhook call once set via setWebhook, so the
+// handler can reject requests that didn't actually come from Telegram). An
+// empty botToken leaves the provider present but inert: Send and the
+// verification flow both return errors instead of panicking on a missing
+// credential, which keeps this an opt-in channel for the (most) deployments
+// that never register a bot at all.
+func NewTelegramProvider(botToken, botUsername, webhookSecret string) *TelegramProvider {
+    return &TelegramProvider{
+        botToken:      botToken,
+        botUsername:   botUsername,
+        webhookSecret: webhookSecret,
+        httpClient:    &http.Client{Timeout: 10 * time.Second},
+        pending:       make(map[string]pendingTelegramVerification),
+        attempts:      make(map[string]*telegramPINAttempts),
+    }
+}
+
+// ValidateWebhookSecret reports whether token matches the secret_token this
+// provider was configured with. If no secret is configured, it passes
+// through and logs once per call so an operator notices the webhook is
+// unauthenticated rather than failing silently.
+func (p *TelegramProvider) ValidateWebhookSecret(token string) bool {
+    if p.webhookSecret == "" {
+        log.Printf("warning: TELEGRAM_WEBHOOK_SECRET is not set; accepting unauthenticated webhook calls")
+        return true
+    }
+    return subtle.ConstantTimeCompare([]byte(token), []byte(p.webhookSecret)) == 1
+}
+
+type telegramInlineButton struct {
+    Text         string `json:"text"`
+    CallbackData string `json:"callback_data"`
+}
+
+type telegramSendMessageRequest struct {
+    ChatID      string                 `json:"chat_id"`
+    Text        string                 `json:"text"`
+    ParseMode   string                 `json:"parse_mode"`
+    ReplyMarkup *telegramReplyMarkup   `json:"reply_markup,omitempty"`
+}
+
+type telegramReplyMarkup struct {
+    InlineKeyboard [][]telegramInlineButton `json:"inline_keyboard"`
+}
+
+type telegramAPIResponse struct {
+    OK     bool `json:"ok"`
+    Result struct {
+        MessageID int `json:"message_id"`
+    } `json:"result"`
+    Description string `json:"description"`
+}
+
+// Send posts a MarkdownV2 message to the given chat, attaching an inline
+// keyboard built from data["buttons"] when present, e.g. for approve/deny
+// step-up prompts.
+func (p *TelegramProvider) Send(chatID, message string, data map[string]interface{}) (string, error) {
+    if p.botToken == "" {
+        return "", fmt.Errorf("Telegram provider not configured")
+    }
+
+    req := telegramSendMessageRequest{
+        ChatID:    chatID,
+        Text:      escapeMarkdownV2(message),
+        ParseMode: "MarkdownV2",
+    }
+
+    if markup := buildInlineKeyboard(data); markup != nil {
+        req.ReplyMarkup = markup
+    }
+
+    body, err := json.Marshal(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to encode Telegram request: %v", err)
+    }
+
+    url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIBase, p.botToken)
+    resp, err := p.httpClient.Post(url, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return "", fmt.Errorf("failed to call Telegram sendMessage: %v", err)
+    }
+    defer resp.Body.Close()
+
+    respBody, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return "", fmt.Errorf("failed to read Telegram response: %v", err)
+    }
+
+    var apiResp telegramAPIResponse
+    if err := json.Unmarshal(respBody, &apiResp); err != nil {
+        return "", fmt.Errorf("failed to parse Telegram response: %v", err)
+    }
+    if !apiResp.OK {
+        return "", fmt.Errorf("Telegram API error: %s", apiResp.Description)
+    }
+
+    return strconv.Itoa(apiResp.Result.MessageID), nil
+}
+
+// buildInlineKeyboard converts req.Data["buttons"] (a list of
+// {"text": "...", "callback_data": "..."} objects) into Telegram's
+// reply_markup shape, one button per row.
+func buildInlineKeyboard(data map[string]interface{}) *telegramReplyMarkup {
+    raw, ok := data["buttons"]
+    if !ok {
+        return nil
+    }
+
+    rawButtons, ok := raw.([]interface{})
+    if !ok || len(rawButtons) == 0 {
+        return nil
+    }
+
+    var rows [][]telegramInlineButton
+    for _, item := range rawButtons {
+        fields, ok := item.(map[string]interface{})
+        if !ok {
+            continue
+        }
+
+        text, _ := fields["text"].(string)
+        callbackData, _ := fields["callback_data"].(string)
+        if text == "" || callbackData == "" {
+            continue
+        }
+
+        rows = append(rows, []telegramInlineButton{{Text: text, CallbackData: callbackData}})
+    }
+
+    if len(rows) == 0 {
+        return nil
+    }
+    return &telegramReplyMarkup{InlineKeyboard: rows}
+}
+
+// telegramMarkdownV2SpecialChars are the characters Telegram requires
+// callers to escape in MarkdownV2 message text.
+const telegramMarkdownV2SpecialChars = "_*[]()~`>#+-=|{}.!"
+
+func escapeMarkdownV2(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        if strings.ContainsRune(telegramMarkdownV2SpecialChars, r) {
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// StartVerification generates a short-lived PIN and the t.me deep link a
+// user taps to link their Telegram account to accountID.
+func (p *TelegramProvider) StartVerification(accountID string) (pin, deepLink string, err error) {
+    if p.botToken == "" {
+        return "", "", fmt.Errorf("Telegram provider not configured")
+    }
+
+    pin, err = randomNumericPIN(telegramPINLength)
+    if err != nil {
+        return "", "", fmt.Errorf("failed to generate verification PIN: %v", err)
+    }
+
+    p.mu.Lock()
+    p.pending[pin] = pendingTelegramVerification{AccountID: accountID, CreatedAt: time.Now()}
+    p.mu.Unlock()
+
+    deepLink = fmt.Sprintf("https://t.me/%s?start=%s", p.botUsername, pin)
+    return pin, deepLink, nil
+}
+
+// ResolvePIN matches a /start <pin> message from chatID to the account that
+// requested it, consuming the PIN so it can't be reused. chatID is locked
+// out for telegramAttemptLockout once it racks up telegramMaxPINAttempts
+// failed guesses, so a guesser can't just keep trying PINs for accountIDs
+// they don't control.
+func (p *TelegramProvider) ResolvePIN(chatID, pin string) (string, bool) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if tracker, ok := p.attempts[chatID]; ok && time.Now().Before(tracker.LockedUntil) {
+        return "", false
+    }
+
+    verification, ok := p.pending[pin]
+    if ok {
+        delete(p.pending, pin)
+    }
+    if !ok || time.Since(verification.CreatedAt) > telegramPINTTL {
+        p.recordFailedAttemptLocked(chatID)
+        return "", false
+    }
+
+    delete(p.attempts, chatID)
+    return verification.AccountID, true
+}
+
+func (p *TelegramProvider) recordFailedAttemptLocked(chatID string) {
+    tracker, ok := p.attempts[chatID]
+    if !ok {
+        tracker = &telegramPINAttempts{}
+        p.attempts[chatID] = tracker
+    }
+    tracker.Failures++
+    if tracker.Failures >= telegramMaxPINAttempts {
+        tracker.LockedUntil = time.Now().Add(telegramAttemptLockout)
+    }
+}
+
+func randomNumericPIN(length int) (string, error) {
+    const digits = "0123456789"
+    buf := make([]byte, length)
+    for i := range buf {
+        n, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+        if err != nil {
+            return "", err
+        }
+        buf[i] = digits[n.Int64()]
+    }
+    return string(buf), nil
+}
+
+// telegramVerifyStartHandler handles POST /v1/telegram/verify/start: it
+// returns a PIN and deep link the user opens in Telegram to link their
+// account.
+func (s *NotificationService) telegramVerifyStartHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        AccountID string `json:"account_id"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if req.AccountID == "" {
+        http.Error(w, "account_id is required", http.StatusBadRequest)
+        return
+    }
+
+    pin, deepLink, err := s.telegramProvider.StartVerification(req.AccountID)
+    if err != nil {
+        http.Error(w, "Failed to start Telegram verification", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "pin":       pin,
+        "deep_link": deepLink,
+    })
+}
+
+// telegramUpdate is the subset of Telegram's webhook Update payload this
+// service cares about.
+type telegramUpdate struct {
+    Message struct {
+        Text string `json:"text"`
+        Chat struct {
+            ID int64 `json:"id"`
+        } `json:"chat"`
+    } `json:"message"`
+}
+
+// telegramWebhookHandler handles POST /v1/telegram/webhook: it matches a
+// "/start <pin>" message to the pending verification and registers the
+// resulting chat_id as a subscriber.
+func (s *NotificationService) telegramWebhookHandler(w http.ResponseWriter, r *http.Request) {
+    if !s.telegramProvider.ValidateWebhookSecret(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")) {
+        http.Error(w, "Invalid webhook secret token", http.StatusUnauthorized)
+        return
+    }
+
+    var update telegramUpdate
+    if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+        http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+        return
+    }
+
+    parts := strings.Fields(update.Message.Text)
+    if len(parts) != 2 || parts[0] != "/start" {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+
+    chatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+    accountID, ok := s.telegramProvider.ResolvePIN(chatID, parts[1])
+    if !ok {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+
+    now := time.Now().UTC()
+    sub := NotificationSubscriber{
+        AccountID:   accountID,
+        Provider:    ProviderTelegram,
+        DeviceID:    chatID,
+        DeviceToken: chatID,
+        CreatedAt:   now,
+        LastSeen:    now,
+    }
+    if err := s.subscriberStore.Upsert(sub); err != nil {
+        http.Error(w, "Failed to register Telegram subscriber", http.StatusInternalServerError)
+        return
+    }
+
+    if _, err := s.telegramProvider.Send(chatID, "You're linked! You'll now receive notifications here.", nil); err != nil {
+        log.Printf("failed to send Telegram confirmation to chat %s: %v", chatID, err)
+    }
+
+    w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,45 @@
+// notification_service/telegram_test.go
+package main
+
+import "testing"
+
+func TestResolvePINConsumesAValidPIN(t *testing.T) {
+    p := NewTelegramProvider("token", "bot", "secret")
+
+    pin, _, err := p.StartVerification("acct-1")
+    if err != nil {
+        t.Fatalf("StartVerification() error = %v", err)
+    }
+
+    accountID, ok := p.ResolvePIN("chat-1", pin)
+    if !ok || accountID != "acct-1" {
+        t.Fatalf("ResolvePIN() = (%q, %v), want (acct-1, true)", accountID, ok)
+    }
+
+    if _, ok := p.ResolvePIN("chat-1", pin); ok {
+        t.Fatalf("ResolvePIN() succeeded twice on the same PIN, want it consumed")
+    }
+}
+
+func TestResolvePINLocksOutAfterRepeatedGuesses(t *testing.T) {
+    p := NewTelegramProvider("token", "bot", "secret")
+
+    if _, _, err := p.StartVerification("acct-1"); err != nil {
+        t.Fatalf("StartVerification() error = %v", err)
+    }
+
+    for i := 0; i < telegramMaxPINAttempts; i++ {
+        if _, ok := p.ResolvePIN("chat-attacker", "000000"); ok {
+            t.Fatalf("wrong-PIN guess unexpectedly succeeded")
+        }
+    }
+
+    pin, _, err := p.StartVerification("acct-2")
+    if err != nil {
+        t.Fatalf("StartVerification() error = %v", err)
+    }
+
+    if _, ok := p.ResolvePIN("chat-attacker", pin); ok {
+        t.Fatalf("locked-out chat resolved a PIN, want lockout to still apply")
+    }
+}
@@ -0,0 +1,217 @@
+// notification_service/templates.go
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "html/template"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    texttemplate "text/template"
+)
+
+const defaultLocale = "en"
+
+// LocaleVariant is one language's copy for a template: a subject line plus
+// plain-text and HTML bodies, and the variable names the caller must supply
+// in NotificationRequest.Data for it to render.
+type LocaleVariant struct {
+    Subject      string   `json:"subject"`
+    Text         string   `json:"text"`
+    HTML         string   `json:"html"`
+    RequiredVars []string `json:"required_vars"`
+}
+
+// NotificationTemplateDefinition is the on-disk shape of a template: one
+// entry per supported locale, with a fallback for locales it doesn't cover.
+type NotificationTemplateDefinition struct {
+    TemplateID     string                   `json:"template_id"`
+    DefaultLocale  string                   `json:"default_locale"`
+    Locales        map[string]LocaleVariant `json:"locales"`
+}
+
+// RenderedTemplate is the result of rendering a template against caller
+// data, ready to feed into the email, SMS, or push send path.
+type RenderedTemplate struct {
+    Subject string
+    Text    string
+    HTML    string
+}
+
+// TemplateRegistry resolves and renders templates by ID and locale.
+type TemplateRegistry interface {
+    Render(templateID, locale string, data map[string]interface{}) (*RenderedTemplate, error)
+}
+
+// FileTemplateRegistry loads template definitions from JSON files on disk
+// (or an S3-synced local path) at startup.
+type FileTemplateRegistry struct {
+    templates map[string]NotificationTemplateDefinition
+}
+
+// NewFileTemplateRegistry loads every *.json file in dir as a template
+// definition keyed by its template_id.
+func NewFileTemplateRegistry(dir string) (*FileTemplateRegistry, error) {
+    registry := &FileTemplateRegistry{templates: make(map[string]NotificationTemplateDefinition)}
+
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return registry, nil
+        }
+        return nil, fmt.Errorf("failed to read template directory %s: %v", dir, err)
+    }
+
+    for _, entry := range entries {
+        if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+            continue
+        }
+
+        raw, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read template %s: %v", entry.Name(), err)
+        }
+
+        var def NotificationTemplateDefinition
+        if err := json.Unmarshal(raw, &def); err != nil {
+            return nil, fmt.Errorf("failed to parse template %s: %v", entry.Name(), err)
+        }
+        if def.DefaultLocale == "" {
+            def.DefaultLocale = defaultLocale
+        }
+
+        registry.templates[def.TemplateID] = def
+    }
+
+    return registry, nil
+}
+
+func (r *FileTemplateRegistry) variant(templateID, locale string) (LocaleVariant, error) {
+    def, ok := r.templates[templateID]
+    if !ok {
+        return LocaleVariant{}, fmt.Errorf("unknown template_id: %s", templateID)
+    }
+
+    if variant, ok := def.Locales[locale]; ok {
+        return variant, nil
+    }
+    if variant, ok := def.Locales[def.DefaultLocale]; ok {
+        return variant, nil
+    }
+
+    return LocaleVariant{}, fmt.Errorf("template %s has no locale variant for %q or default %q", templateID, locale, def.DefaultLocale)
+}
+
+// Render validates that every required variable is present in data, then
+// renders the subject and both text/html bodies for the resolved locale.
+func (r *FileTemplateRegistry) Render(templateID, locale string, data map[string]interface{}) (*RenderedTemplate, error) {
+    variant, err := r.variant(templateID, locale)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, required := range variant.RequiredVars {
+        if _, ok := data[required]; !ok {
+            return nil, fmt.Errorf("missing required template variable: %s", required)
+        }
+    }
+
+    subject, err := renderText(variant.Subject, data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to render subject: %v", err)
+    }
+
+    text, err := renderText(variant.Text, data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to render text body: %v", err)
+    }
+
+    htmlBody, err := renderHTML(variant.HTML, data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to render html body: %v", err)
+    }
+
+    return &RenderedTemplate{Subject: subject, Text: text, HTML: htmlBody}, nil
+}
+
+func renderText(tmplSource string, data map[string]interface{}) (string, error) {
+    if tmplSource == "" {
+        return "", nil
+    }
+
+    tmpl, err := texttemplate.New("tmpl").Parse(tmplSource)
+    if err != nil {
+        return "", err
+    }
+
+    var buf bytes.Buffer
+    if err := tmpl.Execute(&buf, data); err != nil {
+        return "", err
+    }
+    return buf.String(), nil
+}
+
+func renderHTML(tmplSource string, data map[string]interface{}) (string, error) {
+    if tmplSource == "" {
+        return "", nil
+    }
+
+    tmpl, err := template.New("tmpl").Parse(tmplSource)
+    if err != nil {
+        return "", err
+    }
+
+    var buf bytes.Buffer
+    if err := tmpl.Execute(&buf, data); err != nil {
+        return "", err
+    }
+    return buf.String(), nil
+}
+
+// resolveLocale picks the recipient's locale, falling back to the request's
+// locale and then the service default.
+func resolveLocale(recipientLocale, requestLocale string) string {
+    if recipientLocale != "" {
+        return recipientLocale
+    }
+    if requestLocale != "" {
+        return requestLocale
+    }
+    return defaultLocale
+}
+
+// previewTemplateHandler renders a template against sample data without
+// sending anything, so template authors can check their work safely.
+func (s *NotificationService) previewTemplateHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        TemplateID string                 `json:"template_id"`
+        Locale     string                 `json:"locale"`
+        Data       map[string]interface{} `json:"data"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if req.TemplateID == "" {
+        http.Error(w, "template_id is required", http.StatusBadRequest)
+        return
+    }
+
+    locale := req.Locale
+    if locale == "" {
+        locale = defaultLocale
+    }
+
+    rendered, err := s.templateRegistry.Render(req.TemplateID, locale, req.Data)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(rendered)
+}